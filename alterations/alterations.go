@@ -10,6 +10,8 @@ import (
 	"unicode"
 
 	"github.com/OWASP/Amass/stringset"
+	"github.com/gobwas/glob"
+	"golang.org/x/net/publicsuffix"
 )
 
 const (
@@ -53,6 +55,121 @@ type State struct {
 	EditDistance   int
 	Prefixes       *Cache
 	Suffixes       *Cache
+
+	// LabelIndex selects which label above the eTLD+1 the alteration
+	// techniques mutate, counting left-to-right from the left-most label
+	// (0, the default, is the left-most label).
+	// It is ignored when AllLabels is set.
+	LabelIndex int
+	// AllLabels, when true, runs each technique against every label
+	// above the eTLD+1 in turn instead of just the one named by
+	// LabelIndex, unioning the results.
+	AllLabels bool
+
+	// Include, when non-empty, requires a generated name to match at
+	// least one of these patterns to be emitted. Exclude drops any
+	// generated name that matches one of its patterns, even if it also
+	// matched Include. Set them with SetIncludePatterns/SetExcludePatterns
+	// so the glob patterns are compiled once and reused across calls.
+	Include []glob.Glob
+	Exclude []glob.Glob
+
+	// FilterPerLabel, when true, has FuzzyLabelSearches apply Include/
+	// Exclude after every edit-distance round instead of only once at
+	// the end, pruning the candidate pool before it is grown again.
+	// This matters because the edit-distance Cartesian product compounds
+	// every round, so filtering early keeps it from ever being built.
+	FilterPerLabel bool
+
+	// MinRepeatLen and MaxRepeatLen bound the substring lengths (in
+	// runes) that LearnFromCorpus will consider. Zero means use the
+	// package defaults of 3 and 12.
+	MinRepeatLen int
+	MaxRepeatLen int
+
+	// Markov holds the trained n-gram models MarkovLabels draws from,
+	// keyed by n. Populate it with TrainMarkov.
+	Markov map[int]*MarkovModel
+}
+
+// SetIncludePatterns compiles patterns and stores them as Include,
+// replacing any patterns previously set.
+func (s *State) SetIncludePatterns(patterns []string) error {
+	globs, err := compileGlobs(patterns)
+	if err != nil {
+		return err
+	}
+
+	s.Include = globs
+	return nil
+}
+
+// SetExcludePatterns compiles patterns and stores them as Exclude,
+// replacing any patterns previously set.
+func (s *State) SetExcludePatterns(patterns []string) error {
+	globs, err := compileGlobs(patterns)
+	if err != nil {
+		return err
+	}
+
+	s.Exclude = globs
+	return nil
+}
+
+func compileGlobs(patterns []string) ([]glob.Glob, error) {
+	globs := make([]glob.Glob, len(patterns))
+
+	for i, pattern := range patterns {
+		g, err := glob.Compile(pattern, '.')
+		if err != nil {
+			return nil, err
+		}
+		globs[i] = g
+	}
+
+	return globs, nil
+}
+
+// matches reports whether name satisfies the Include/Exclude filters: it
+// must match at least one Include pattern (when any are set) and must
+// match none of the Exclude patterns.
+func (s *State) matches(name string) bool {
+	if len(s.Include) > 0 {
+		included := false
+		for _, g := range s.Include {
+			if g.Match(name) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+
+	for _, g := range s.Exclude {
+		if g.Match(name) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// filter drops any name in names that fails the Include/Exclude patterns.
+func (s *State) filter(names []string) []string {
+	if len(s.Include) == 0 && len(s.Exclude) == 0 {
+		return names
+	}
+
+	kept := make([]string, 0, len(names))
+	for _, name := range names {
+		if s.matches(name) {
+			kept = append(kept, name)
+		}
+	}
+
+	return kept
 }
 
 // NewState returns an initialized State.
@@ -63,15 +180,78 @@ func NewState(wordlist []string) *State {
 	}
 }
 
+// splitName uses the Public Suffix List to separate name into the labels
+// sitting above the registered domain (etld1) and that registered domain
+// itself, so alteration techniques never mutate the eTLD+1 or collapse
+// intermediate labels (e.g. "dev-api.foo.example.co.uk" yields
+// labels = ["dev-api", "foo"] and etld1 = "example.co.uk").
+func splitName(name string) (labels []string, etld1 string, err error) {
+	etld1, err = publicsuffix.EffectiveTLDPlusOne(name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sub := strings.TrimSuffix(name, "."+etld1)
+	if sub == name {
+		// name is already the registered domain; no labels above it.
+		return []string{}, etld1, nil
+	}
+
+	return strings.Split(sub, "."), etld1, nil
+}
+
+// assemble rebuilds a full name from labels, the registered domain, and a
+// replacement for labels[idx].
+func assemble(labels []string, idx int, label, etld1 string) string {
+	out := make([]string, len(labels))
+	copy(out, labels)
+	out[idx] = label
+
+	return strings.Join(out, ".") + "." + etld1
+}
+
+// targetIndices returns the label indices that an alteration technique
+// should mutate, honoring AllLabels and LabelIndex.
+func (s *State) targetIndices(numLabels int) []int {
+	if numLabels == 0 {
+		return nil
+	}
+
+	if s.AllLabels {
+		indices := make([]int, numLabels)
+		for i := range indices {
+			indices[i] = i
+		}
+		return indices
+	}
+
+	idx := s.LabelIndex
+	if idx < 0 || idx >= numLabels {
+		idx = 0
+	}
+
+	return []int{idx}
+}
+
 // FlipWords flips prefixes and suffixes found within the provided name.
 func (s *State) FlipWords(name string) []string {
-	names := strings.SplitN(name, ".", 2)
-	subdomain := names[0]
-	domain := names[1]
+	labels, etld1, err := splitName(name)
+	if err != nil || len(labels) == 0 {
+		return []string{}
+	}
 
-	parts := strings.Split(subdomain, "-")
+	newNames := stringset.New()
+	for _, idx := range s.targetIndices(len(labels)) {
+		newNames.InsertMany(s.flipWordsInLabel(labels, idx, etld1)...)
+	}
+
+	return s.filter(newNames.Slice())
+}
+
+func (s *State) flipWordsInLabel(labels []string, idx int, etld1 string) []string {
+	parts := strings.Split(labels[idx], "-")
 	if len(parts) < 2 {
-		return []string{}
+		return nil
 	}
 
 	newNames := stringset.New()
@@ -81,7 +261,7 @@ func (s *State) FlipWords(name string) []string {
 	s.Prefixes.RLock()
 	for k, count := range s.Prefixes.Counters {
 		if count >= s.MinForWordFlip {
-			newNames.Insert(k + "-" + strings.Join(parts[1:], "-") + "." + domain)
+			newNames.Insert(assemble(labels, idx, k+"-"+strings.Join(parts[1:], "-"), etld1))
 		}
 	}
 	s.Prefixes.RUnlock()
@@ -91,7 +271,7 @@ func (s *State) FlipWords(name string) []string {
 	s.Suffixes.RLock()
 	for k, count := range s.Suffixes.Counters {
 		if count >= s.MinForWordFlip {
-			newNames.Insert(strings.Join(parts[:len(parts)-1], "-") + "-" + k + "." + domain)
+			newNames.Insert(assemble(labels, idx, strings.Join(parts[:len(parts)-1], "-")+"-"+k, etld1))
 		}
 	}
 	s.Suffixes.RUnlock()
@@ -101,133 +281,180 @@ func (s *State) FlipWords(name string) []string {
 
 // FlipNumbers flips numbers in a subdomain name.
 func (s *State) FlipNumbers(name string) []string {
-	n := name
-	parts := strings.SplitN(n, ".", 2)
+	labels, etld1, err := splitName(name)
+	if err != nil || len(labels) == 0 {
+		return []string{}
+	}
+
+	newNames := stringset.New()
+	for _, idx := range s.targetIndices(len(labels)) {
+		newNames.InsertMany(s.flipNumbersInLabel(labels, idx, etld1)...)
+	}
+
+	return s.filter(newNames.Slice())
+}
+
+func (s *State) flipNumbersInLabel(labels []string, idx int, etld1 string) []string {
+	label := labels[idx]
 
 	// Find the first character that is a number
-	first := strings.IndexFunc(parts[0], unicode.IsNumber)
+	first := strings.IndexFunc(label, unicode.IsNumber)
 	if first < 0 {
-		return []string{}
+		return nil
 	}
 
 	newNames := stringset.New()
 
 	// Flip the first number and attempt a second number
 	for i := 0; i < 10; i++ {
-		sf := n[:first] + strconv.Itoa(i) + n[first+1:]
+		sf := label[:first] + strconv.Itoa(i) + label[first+1:]
 
-		newNames.InsertMany(s.secondNumberFlip(sf, first+1)...)
+		for _, alt := range s.secondNumberFlip(sf, first+1) {
+			newNames.Insert(assemble(labels, idx, alt, etld1))
+		}
 	}
 
 	// Take the first number out
-	newNames.InsertMany(s.secondNumberFlip(n[:first]+n[first+1:], -1)...)
+	for _, alt := range s.secondNumberFlip(label[:first]+label[first+1:], -1) {
+		newNames.Insert(assemble(labels, idx, alt, etld1))
+	}
 
 	return newNames.Slice()
 }
 
-func (s *State) secondNumberFlip(name string, minIndex int) []string {
-	parts := strings.SplitN(name, ".", 2)
-
+func (s *State) secondNumberFlip(label string, minIndex int) []string {
 	// Find the second character that is a number
-	last := strings.LastIndexFunc(parts[0], unicode.IsNumber)
+	last := strings.LastIndexFunc(label, unicode.IsNumber)
 	if last < 0 || last < minIndex {
-		return []string{name}
+		return []string{label}
 	}
 
-	var newNames []string
+	var labels []string
 	// Flip those numbers and send out the mutations
 	for i := 0; i < 10; i++ {
-		n := name[:last] + strconv.Itoa(i) + name[last+1:]
-
-		newNames = append(newNames, n)
+		labels = append(labels, label[:last]+strconv.Itoa(i)+label[last+1:])
 	}
 
 	// Take the second number out
-	newNames = append(newNames, name[:last]+name[last+1:])
+	labels = append(labels, label[:last]+label[last+1:])
 
-	return newNames
+	return labels
 }
 
 // AppendNumbers appends a number to a subdomain name.
 func (s *State) AppendNumbers(name string) []string {
-	parts := strings.SplitN(name, ".", 2)
-
-	parts[0] = strings.Trim(parts[0], "-")
-	if parts[0] == "" {
+	labels, etld1, err := splitName(name)
+	if err != nil || len(labels) == 0 {
 		return []string{}
 	}
 
 	newNames := stringset.New()
-	for i := 0; i < 10; i++ {
-		newNames.InsertMany(s.addSuffix(parts, strconv.Itoa(i))...)
+	for _, idx := range s.targetIndices(len(labels)) {
+		label := strings.Trim(labels[idx], "-")
+		if label == "" {
+			continue
+		}
+
+		for i := 0; i < 10; i++ {
+			for _, alt := range s.addSuffix(label, strconv.Itoa(i)) {
+				newNames.Insert(assemble(labels, idx, alt, etld1))
+			}
+		}
 	}
 
-	return newNames.Slice()
+	return s.filter(newNames.Slice())
 }
 
 // AddSuffixWord appends a suffix to a subdomain name.
 func (s *State) AddSuffixWord(name string) []string {
-	parts := strings.SplitN(name, ".", 2)
+	labels, etld1, err := splitName(name)
+	if err != nil || len(labels) == 0 {
+		return []string{}
+	}
 
 	s.Suffixes.RLock()
 	defer s.Suffixes.RUnlock()
 
-	parts[0] = strings.Trim(parts[0], "-")
-	if parts[0] == "" {
-		return []string{}
-	}
-
 	newNames := stringset.New()
-	for word, count := range s.Suffixes.Counters {
-		if count >= s.MinForWordFlip {
-			newNames.InsertMany(s.addSuffix(parts, word)...)
+	for _, idx := range s.targetIndices(len(labels)) {
+		label := strings.Trim(labels[idx], "-")
+		if label == "" {
+			continue
+		}
+
+		for word, count := range s.Suffixes.Counters {
+			if count >= s.MinForWordFlip {
+				for _, alt := range s.addSuffix(label, word) {
+					newNames.Insert(assemble(labels, idx, alt, etld1))
+				}
+			}
 		}
 	}
 
-	return newNames.Slice()
+	return s.filter(newNames.Slice())
 }
 
 // AddPrefixWord appends a subdomain name to a prefix.
 func (s *State) AddPrefixWord(name string) []string {
-	s.Prefixes.RLock()
-	defer s.Prefixes.RUnlock()
-
-	name = strings.Trim(name, "-")
-	if name == "" {
+	labels, etld1, err := splitName(name)
+	if err != nil || len(labels) == 0 {
 		return []string{}
 	}
 
+	s.Prefixes.RLock()
+	defer s.Prefixes.RUnlock()
+
 	newNames := stringset.New()
-	for word, count := range s.Prefixes.Counters {
-		if count >= s.MinForWordFlip {
+	for _, idx := range s.targetIndices(len(labels)) {
+		label := strings.Trim(labels[idx], "-")
+		if label == "" {
+			continue
+		}
 
-			newNames.InsertMany(s.addPrefix(name, word)...)
+		for word, count := range s.Prefixes.Counters {
+			if count >= s.MinForWordFlip {
+				for _, alt := range s.addPrefix(label, word) {
+					newNames.Insert(assemble(labels, idx, alt, etld1))
+				}
+			}
 		}
 	}
 
-	return newNames.Slice()
+	return s.filter(newNames.Slice())
 }
 
-func (s *State) addSuffix(parts []string, suffix string) []string {
+func (s *State) addSuffix(label, suffix string) []string {
 	return []string{
-		parts[0] + suffix + "." + parts[1],
-		parts[0] + "-" + suffix + "." + parts[1],
+		label + suffix,
+		label + "-" + suffix,
 	}
 }
 
-func (s *State) addPrefix(name, prefix string) []string {
+func (s *State) addPrefix(label, prefix string) []string {
 	return []string{
-		prefix + name,
-		prefix + "-" + name,
+		prefix + label,
+		prefix + "-" + label,
 	}
 }
 
 // FuzzyLabelSearches returns new names generated by making slight
 // mutations to the provided name.
 func (s *State) FuzzyLabelSearches(name string) []string {
-	parts := strings.SplitN(name, ".", 2)
+	labels, etld1, err := splitName(name)
+	if err != nil || len(labels) == 0 {
+		return []string{}
+	}
 
-	results := []string{parts[0]}
+	newNames := stringset.New()
+	for _, idx := range s.targetIndices(len(labels)) {
+		newNames.InsertMany(s.fuzzyLabel(labels, idx, etld1)...)
+	}
+
+	return s.filter(newNames.Slice())
+}
+
+func (s *State) fuzzyLabel(labels []string, idx int, etld1 string) []string {
+	results := []string{labels[idx]}
 	for i := 0; i < s.EditDistance; i++ {
 		var conv []string
 
@@ -235,6 +462,14 @@ func (s *State) FuzzyLabelSearches(name string) []string {
 		conv = append(conv, s.deletions(results)...)
 		conv = append(conv, s.substitutions(results)...)
 		results = append(results, conv...)
+
+		// The edit-distance Cartesian product compounds every round, so
+		// when FilterPerLabel is set, prune candidates against the full
+		// assembled name as soon as each round produces them instead of
+		// growing every round's worth before filtering once at the end.
+		if s.FilterPerLabel {
+			results = s.filterAssembled(results, labels, idx, etld1)
+		}
 	}
 
 	newNames := stringset.New()
@@ -244,12 +479,34 @@ func (s *State) FuzzyLabelSearches(name string) []string {
 			continue
 		}
 
-		newNames.Insert(label + "." + parts[1])
+		newNames.Insert(assemble(labels, idx, label, etld1))
 	}
 
 	return newNames.Slice()
 }
 
+// filterAssembled drops any candidate label whose assembled name fails the
+// Include/Exclude patterns.
+func (s *State) filterAssembled(candidates, labels []string, idx int, etld1 string) []string {
+	if len(s.Include) == 0 && len(s.Exclude) == 0 {
+		return candidates
+	}
+
+	kept := make([]string, 0, len(candidates))
+	for _, alt := range candidates {
+		label := strings.Trim(alt, "-")
+		if label == "" {
+			continue
+		}
+
+		if s.matches(assemble(labels, idx, label, etld1)) {
+			kept = append(kept, alt)
+		}
+	}
+
+	return kept
+}
+
 func (s *State) additions(set []string) []string {
 	ldh := []rune(ldhChars)
 	ldhLen := len(ldh)
@@ -0,0 +1,56 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package alterations
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitName(t *testing.T) {
+	tests := []struct {
+		name       string
+		wantLabels []string
+		wantETLD1  string
+	}{
+		{"dev-api.foo.example.co.uk", []string{"dev-api", "foo"}, "example.co.uk"},
+		{"foo.co.uk", []string{}, "foo.co.uk"},
+		{"x.foo.co.uk", []string{"x"}, "foo.co.uk"},
+		{"example.co.uk", []string{}, "example.co.uk"},
+		{"www.blog.example.github.io", []string{"www", "blog"}, "example.github.io"},
+		{"cache.my-bucket.s3.amazonaws.com", []string{"cache"}, "my-bucket.s3.amazonaws.com"},
+	}
+
+	for _, tt := range tests {
+		labels, etld1, err := splitName(tt.name)
+		if err != nil {
+			t.Errorf("splitName(%q) returned error: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(labels, tt.wantLabels) {
+			t.Errorf("splitName(%q) labels = %v, want %v", tt.name, labels, tt.wantLabels)
+		}
+		if etld1 != tt.wantETLD1 {
+			t.Errorf("splitName(%q) etld1 = %q, want %q", tt.name, etld1, tt.wantETLD1)
+		}
+	}
+}
+
+func TestFlipWordsMultiLevelETLD(t *testing.T) {
+	s := NewState([]string{"prod"})
+	s.MinForWordFlip = 0
+
+	for _, name := range s.FlipWords("dev-api.foo.example.co.uk") {
+		labels, etld1, err := splitName(name)
+		if err != nil {
+			t.Fatalf("splitName(%q) returned error: %v", name, err)
+		}
+		if etld1 != "example.co.uk" {
+			t.Errorf("FlipWords mutated the registered domain: got %q in %q", etld1, name)
+		}
+		if len(labels) != 2 || labels[1] != "foo" {
+			t.Errorf("FlipWords mutated an intermediate label: got labels %v from %q", labels, name)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package alterations
+
+import "testing"
+
+func TestMatchesInclude(t *testing.T) {
+	s := &State{}
+	if err := s.SetIncludePatterns([]string{"**.prod.example.com"}); err != nil {
+		t.Fatalf("SetIncludePatterns returned error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"api.prod.example.com", true},
+		{"a.b.prod.example.com", true},
+		{"api.stg.example.com", false},
+		{"prod.example.com", false}, // the "." after "**" needs a label before "prod"
+	}
+
+	for _, tt := range tests {
+		if got := s.matches(tt.name); got != tt.want {
+			t.Errorf("matches(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatchesIncludeCharacterClass(t *testing.T) {
+	s := &State{}
+	if err := s.SetIncludePatterns([]string{"api-[0-9]*.example.com"}); err != nil {
+		t.Fatalf("SetIncludePatterns returned error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"api-1.example.com", true},
+		{"api-42.example.com", true},
+		{"api-prod.example.com", false},
+		{"web-1.example.com", false},
+	}
+
+	for _, tt := range tests {
+		if got := s.matches(tt.name); got != tt.want {
+			t.Errorf("matches(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatchesExcludeOverridesInclude(t *testing.T) {
+	s := &State{}
+	if err := s.SetIncludePatterns([]string{"**.example.com"}); err != nil {
+		t.Fatalf("SetIncludePatterns returned error: %v", err)
+	}
+	if err := s.SetExcludePatterns([]string{"**.stg.example.com"}); err != nil {
+		t.Fatalf("SetExcludePatterns returned error: %v", err)
+	}
+
+	if !s.matches("api.prod.example.com") {
+		t.Errorf("matches(%q) = false, want true", "api.prod.example.com")
+	}
+	if s.matches("api.stg.example.com") {
+		t.Errorf("matches(%q) = true, want false", "api.stg.example.com")
+	}
+}
+
+func TestFilterNoPatternsPassesEverythingThrough(t *testing.T) {
+	s := &State{}
+	names := []string{"a.example.com", "b.example.com"}
+
+	got := s.filter(names)
+	if len(got) != len(names) {
+		t.Errorf("filter with no patterns changed the name count: got %d, want %d", len(got), len(names))
+	}
+}
+
+func TestAddPrefixWordAppliesIncludeFilter(t *testing.T) {
+	s := NewState([]string{"dev", "stg"})
+	s.MinForWordFlip = 0
+	if err := s.SetIncludePatterns([]string{"dev-*.example.com"}); err != nil {
+		t.Fatalf("SetIncludePatterns returned error: %v", err)
+	}
+
+	for _, name := range s.AddPrefixWord("api.example.com") {
+		if !s.matches(name) {
+			t.Errorf("AddPrefixWord emitted %q, which fails its own Include patterns", name)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package alterations
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/OWASP/Amass/stringset"
+)
+
+const (
+	markovStart = '\x02'
+	markovEnd   = '\x03'
+
+	markovCandidates  = 50
+	markovMaxLabelLen = 24
+	markovMaxAttempts = 20
+)
+
+// MarkovModel is a character-level n-gram model trained on a corpus of
+// label strings and used to generate plausible new labels. Order is the
+// n-gram size (e.g. 3 for trigrams); the context used to predict the next
+// rune is the trailing Order-1 runes. Transitions also records every
+// shorter suffix of that context seen during training, which is what lets
+// Generate back off to a shorter (and eventually empty, i.e. unigram)
+// context when the full one was never observed.
+type MarkovModel struct {
+	Order       int
+	Transitions map[string]map[rune]int
+	// Rand, when set, is used instead of the package-level math/rand
+	// functions, allowing deterministic generation in tests.
+	Rand *rand.Rand
+}
+
+// NewMarkovModel returns a MarkovModel of the given order ready for Train.
+func NewMarkovModel(order int) *MarkovModel {
+	if order < 1 {
+		order = 1
+	}
+
+	return &MarkovModel{
+		Order:       order,
+		Transitions: make(map[string]map[rune]int),
+	}
+}
+
+func (m *MarkovModel) contextLen() int {
+	if m.Order <= 1 {
+		return 0
+	}
+	return m.Order - 1
+}
+
+// Train updates the model's transition counts from the provided labels.
+func (m *MarkovModel) Train(labels []string) {
+	ctxLen := m.contextLen()
+
+	for _, label := range labels {
+		padded := strings.Repeat(string(markovStart), ctxLen) + label + string(markovEnd)
+		runes := []rune(padded)
+
+		for i := ctxLen; i < len(runes); i++ {
+			// Record every suffix of the context, from the full
+			// Order-1 length down to empty, so generation always has
+			// a shorter context to back off to.
+			for l := 0; l <= ctxLen && l <= i; l++ {
+				ctx := string(runes[i-l : i])
+				m.record(ctx, runes[i])
+			}
+		}
+	}
+}
+
+func (m *MarkovModel) record(ctx string, next rune) {
+	if m.Transitions[ctx] == nil {
+		m.Transitions[ctx] = make(map[rune]int)
+	}
+	m.Transitions[ctx][next]++
+}
+
+// Generate samples a new label from the model, stopping at the end
+// sentinel or once maxLen runes have been produced. It retries until it
+// produces an LDH label not already present in seen, or gives up and
+// returns an empty string after markovMaxAttempts tries.
+func (m *MarkovModel) Generate(maxLen int, seen map[string]bool) string {
+	ctxLen := m.contextLen()
+
+	for attempt := 0; attempt < markovMaxAttempts; attempt++ {
+		ctx := strings.Repeat(string(markovStart), ctxLen)
+
+		var out []rune
+		for len(out) < maxLen {
+			next, ok := m.sample(ctx)
+			if !ok || next == markovEnd {
+				break
+			}
+			out = append(out, next)
+
+			window := append([]rune(ctx), next)
+			if len(window) > ctxLen {
+				window = window[len(window)-ctxLen:]
+			}
+			ctx = string(window)
+		}
+
+		label := strings.Trim(string(out), "-")
+		if label != "" && isLDH(label) && !seen[label] {
+			return label
+		}
+	}
+
+	return ""
+}
+
+// sample draws a rune from the transition distribution for ctx, backing
+// off to progressively shorter suffixes of ctx (and finally the empty,
+// unigram context) when a context was never observed during training.
+func (m *MarkovModel) sample(ctx string) (rune, bool) {
+	for {
+		if dist, ok := m.Transitions[ctx]; ok && len(dist) > 0 {
+			return m.weightedSample(dist), true
+		}
+		if ctx == "" {
+			return 0, false
+		}
+		ctx = string([]rune(ctx)[1:])
+	}
+}
+
+func (m *MarkovModel) weightedSample(dist map[rune]int) rune {
+	// Map iteration order is randomized per range, so walking dist
+	// directly would make the same seeded draw resolve to a different
+	// rune across otherwise-identical models. Sorting the runes first
+	// gives a stable order to subtract counts against.
+	runes := make([]rune, 0, len(dist))
+	total := 0
+	for ch, count := range dist {
+		runes = append(runes, ch)
+		total += count
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+
+	r := m.intn(total)
+	for _, ch := range runes {
+		r -= dist[ch]
+		if r < 0 {
+			return ch
+		}
+	}
+
+	// Unreachable: the loop above always exhausts the total count.
+	panic("weightedSample: distribution exhausted without a selection")
+}
+
+func (m *MarkovModel) intn(n int) int {
+	if m.Rand != nil {
+		return m.Rand.Intn(n)
+	}
+	return rand.Intn(n)
+}
+
+// TrainMarkov builds (or rebuilds) the order-n Markov model that
+// MarkovLabels draws from, training it on the given corpus of label
+// strings.
+func (s *State) TrainMarkov(n int, corpus []string) {
+	if s.Markov == nil {
+		s.Markov = make(map[int]*MarkovModel)
+	}
+
+	model := NewMarkovModel(n)
+	model.Train(corpus)
+	s.Markov[n] = model
+}
+
+// MarkovLabels generates new labels for name using the order-n model
+// previously trained with TrainMarkov, reusing the PSL split so the
+// registered domain is left untouched. Like every other technique in the
+// package, the label(s) mutated are chosen by LabelIndex/AllLabels. It
+// returns an empty slice if no model has been trained for n.
+func (s *State) MarkovLabels(name string, n int) []string {
+	model := s.Markov[n]
+	if model == nil {
+		return []string{}
+	}
+
+	labels, etld1, err := splitName(name)
+	if err != nil || len(labels) == 0 {
+		return []string{}
+	}
+
+	newNames := stringset.New()
+	for _, idx := range s.targetIndices(len(labels)) {
+		newNames.InsertMany(s.markovLabel(model, labels, idx, etld1)...)
+	}
+
+	return s.filter(newNames.Slice())
+}
+
+func (s *State) markovLabel(model *MarkovModel, labels []string, idx int, etld1 string) []string {
+	seen := map[string]bool{labels[idx]: true}
+
+	newNames := stringset.New()
+	for i := 0; i < markovCandidates; i++ {
+		label := model.Generate(markovMaxLabelLen, seen)
+		if label == "" {
+			continue
+		}
+		seen[label] = true
+
+		newNames.Insert(assemble(labels, idx, label, etld1))
+	}
+
+	return newNames.Slice()
+}
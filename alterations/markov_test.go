@@ -0,0 +1,110 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package alterations
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+var markovCorpus = []string{
+	"api", "api-prod", "api-stg", "api-dev",
+	"web", "web-prod", "web-stg",
+	"cdn", "cdn-prod",
+}
+
+func TestMarkovModelGenerateIsLDH(t *testing.T) {
+	m := NewMarkovModel(3)
+	m.Rand = rand.New(rand.NewSource(1))
+	m.Train(markovCorpus)
+
+	for i := 0; i < 50; i++ {
+		label := m.Generate(markovMaxLabelLen, map[string]bool{})
+		if label == "" {
+			continue
+		}
+		if !isLDH(label) {
+			t.Errorf("Generate produced a non-LDH label: %q", label)
+		}
+		if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			t.Errorf("Generate produced a label with a leading/trailing hyphen: %q", label)
+		}
+	}
+}
+
+func TestMarkovModelGenerateDeterministicWithSeed(t *testing.T) {
+	train := func() *MarkovModel {
+		m := NewMarkovModel(3)
+		m.Rand = rand.New(rand.NewSource(42))
+		m.Train(markovCorpus)
+		return m
+	}
+
+	m1, m2 := train(), train()
+
+	for i := 0; i < 20; i++ {
+		l1 := m1.Generate(markovMaxLabelLen, map[string]bool{})
+		l2 := m2.Generate(markovMaxLabelLen, map[string]bool{})
+		if l1 != l2 {
+			t.Fatalf("two models seeded identically diverged on draw %d: %q != %q", i, l1, l2)
+		}
+	}
+}
+
+func TestMarkovModelGenerateRejectsSeen(t *testing.T) {
+	m := NewMarkovModel(2)
+	m.Rand = rand.New(rand.NewSource(7))
+	m.Train([]string{"api"})
+
+	seen := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		label := m.Generate(markovMaxLabelLen, seen)
+		if label == "" {
+			continue
+		}
+		if seen[label] {
+			t.Errorf("Generate returned %q, which was already in seen", label)
+		}
+		seen[label] = true
+	}
+}
+
+func TestMarkovLabelsHonorsTargetIndices(t *testing.T) {
+	s := NewState(nil)
+	s.TrainMarkov(3, markovCorpus)
+	s.AllLabels = true
+
+	var firstMutated, secondMutated bool
+	for _, name := range s.MarkovLabels("api.web.example.com", 3) {
+		labels, etld1, err := splitName(name)
+		if err != nil {
+			t.Fatalf("splitName(%q) returned error: %v", name, err)
+		}
+		if etld1 != "example.com" {
+			t.Errorf("MarkovLabels mutated the registered domain: got %q in %q", etld1, name)
+		}
+		if len(labels) != 2 {
+			t.Errorf("MarkovLabels changed the label count: got %v from %q", labels, name)
+			continue
+		}
+		if labels[0] != "api" && labels[1] == "web" {
+			firstMutated = true
+		}
+		if labels[0] == "api" && labels[1] != "web" {
+			secondMutated = true
+		}
+	}
+	if !firstMutated || !secondMutated {
+		t.Errorf("MarkovLabels with AllLabels did not mutate every label: first=%v second=%v", firstMutated, secondMutated)
+	}
+}
+
+func TestMarkovLabelsNoModelTrained(t *testing.T) {
+	s := NewState(nil)
+
+	if got := s.MarkovLabels("api.example.com", 3); len(got) != 0 {
+		t.Errorf("MarkovLabels with no trained model = %v, want empty", got)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package alterations
+
+import (
+	"index/suffixarray"
+	"strings"
+)
+
+// labelSep joins labels from the corpus into a single byte slice for the
+// suffix array. It can't appear in an LDH label, so it doubles as the
+// label-boundary marker.
+const labelSep = 0x00
+
+const (
+	defaultMinRepeatLen = 3
+	defaultMaxRepeatLen = 12
+)
+
+// LearnFromCorpus mines the subdomain labels found in names for repeated,
+// LDH-valid substrings and feeds them into s.Prefixes and s.Suffixes, the
+// same caches AddPrefixWord and AddSuffixWord read from. Unlike FlipWords,
+// which only ever learns a word when it sits between dashes, this finds
+// tokens embedded without a separator as well (e.g. "api" out of
+// "apistg1.example.com" and "apistg2.example.com", or "v2" out of
+// "cdnv2.example.com" and "appv2.example.com" once MinRepeatLen is 2).
+//
+// A repeat is recorded only once it has been observed; whether it counts
+// toward AddPrefixWord or AddSuffixWord depends on whether its occurrences
+// sit at the start or the end of a label, so a token seen only in the
+// middle of labels is discarded. MinRepeatLen/MaxRepeatLen bound the
+// substring lengths considered (defaulting to 3 and 12 runes), and the
+// actual frequency threshold used by AddPrefixWord/AddSuffixWord is
+// MinForWordFlip, applied downstream the same way it is for every other
+// technique.
+func (s *State) LearnFromCorpus(names []string) {
+	minLen, maxLen := s.MinRepeatLen, s.MaxRepeatLen
+	if minLen <= 0 {
+		minLen = defaultMinRepeatLen
+	}
+	if maxLen <= 0 {
+		maxLen = defaultMaxRepeatLen
+	}
+
+	data, labels := joinLabels(names)
+	if len(data) == 0 {
+		return
+	}
+
+	// Candidates are enumerated per label and resolved against the whole
+	// corpus with idx.Lookup, rather than sorting every suffix of data
+	// ourselves: labels are short and bounded by maxLen, but a corpus can
+	// hold tens of thousands of them, and globally sorting the whole
+	// concatenation is exactly the O(n^2 log n) construction a suffix
+	// array exists to let us avoid.
+	idx := suffixarray.New(data)
+
+	seen := make(map[string]bool)
+	for _, label := range labels {
+		runes := []rune(label)
+
+		for start := range runes {
+			maxL := maxLen
+			if remaining := len(runes) - start; remaining < maxL {
+				maxL = remaining
+			}
+
+			for l := minLen; l <= maxL; l++ {
+				sub := string(runes[start : start+l])
+				if seen[sub] || !isLDH(sub) {
+					continue
+				}
+				seen[sub] = true
+
+				s.learnSubstring(idx, sub, data)
+			}
+		}
+	}
+}
+
+// joinLabels extracts the subdomain labels from every name (via the PSL)
+// and returns both the flat list of labels and their labelSep-joined
+// concatenation for the suffix array.
+func joinLabels(names []string) ([]byte, []string) {
+	var labels []string
+	for _, name := range names {
+		ls, _, err := splitName(name)
+		if err != nil {
+			continue
+		}
+		labels = append(labels, ls...)
+	}
+
+	return []byte(strings.Join(labels, string(rune(labelSep)))), labels
+}
+
+// learnSubstring updates s.Prefixes/s.Suffixes once per occurrence of sub
+// in data that sits at the start or end of a label, mirroring the way
+// FlipWords calls Update once per observed word. Substrings occurring only
+// once across the whole corpus aren't repeats, so they're skipped.
+func (s *State) learnSubstring(idx *suffixarray.Index, sub string, data []byte) {
+	occurrences := idx.Lookup([]byte(sub), -1)
+	if len(occurrences) < 2 {
+		return
+	}
+
+	l := len(sub)
+	for _, p := range occurrences {
+		if p == 0 || data[p-1] == labelSep {
+			s.Prefixes.Update(sub)
+		}
+		if p+l == len(data) || data[p+l] == labelSep {
+			s.Suffixes.Update(sub)
+		}
+	}
+}
+
+// isLDH reports whether s is non-empty and contains only letter-digit-
+// hyphen characters.
+func isLDH(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, r := range s {
+		if !strings.ContainsRune(ldhChars, r) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,78 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package alterations
+
+import "testing"
+
+func TestLearnFromCorpus(t *testing.T) {
+	s := NewState(nil)
+	s.MinRepeatLen = 2
+	s.MaxRepeatLen = 6
+
+	s.LearnFromCorpus([]string{
+		// "api" repeats as a label prefix here...
+		"apistg1.example.com",
+		"apistg2.example.com",
+		// ...and as a label suffix here, so it must be credited to
+		// both Prefixes and Suffixes depending on where it lands.
+		"fooapi.example.com",
+		"barapi.example.com",
+		// "stg" also repeats as a prefix in these two, but it repeats
+		// in the middle of apistg1/apistg2 above too (between "api"
+		// and the trailing digit) - those middle occurrences must be
+		// discarded, not counted.
+		"stgweb1.example.com",
+		"stgweb2.example.com",
+		// "v2" repeats as a 2-rune label suffix, only visible with
+		// MinRepeatLen lowered to 2.
+		"cdnv2.example.com",
+		"appv2.example.com",
+		// "prodserver" is a 10-rune shared prefix, longer than
+		// MaxRepeatLen (6), so it must never be learned in full even
+		// though its bounded 6-rune prefix "prodse" is.
+		"prodserver1.example.com",
+		"prodserver2.example.com",
+		// "a" only ever repeats as a 1-rune prefix, below MinRepeatLen
+		// (2), so it must never be learned.
+		"a1.example.com",
+		"a2.example.com",
+	})
+
+	wantPrefixes := map[string]int{
+		"api":        2,
+		"stg":        2,
+		"prodse":     2,
+		"prodserver": 0,
+		"a":          0,
+	}
+	for word, want := range wantPrefixes {
+		if got := s.Prefixes.Counters[word]; got != want {
+			t.Errorf("Prefixes.Counters[%q] = %d, want %d", word, got, want)
+		}
+	}
+
+	wantSuffixes := map[string]int{
+		"api": 2,
+		"v2":  2,
+	}
+	for word, want := range wantSuffixes {
+		if got := s.Suffixes.Counters[word]; got != want {
+			t.Errorf("Suffixes.Counters[%q] = %d, want %d", word, got, want)
+		}
+	}
+}
+
+func TestLearnFromCorpusEmpty(t *testing.T) {
+	s := NewState(nil)
+
+	// Must not panic on an empty corpus or one with no labels above the
+	// eTLD+1.
+	s.LearnFromCorpus(nil)
+	s.LearnFromCorpus([]string{"example.com"})
+
+	if len(s.Prefixes.Counters) != 0 || len(s.Suffixes.Counters) != 0 {
+		t.Errorf("LearnFromCorpus with no labels produced counters: prefixes=%v suffixes=%v",
+			s.Prefixes.Counters, s.Suffixes.Counters)
+	}
+}